@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FeedConfig describes a single subscription: where its episodes go,
+// how they're filtered, and (optionally) how often it should be
+// checked.
+type FeedConfig struct {
+	URL         string   `yaml:"url"`
+	Destination string   `yaml:"destination,omitempty"`
+	Tags        []string `yaml:"tags,omitempty"`
+	NoTags      []string `yaml:"notags,omitempty"`
+	Limit       int      `yaml:"limit,omitempty"`
+	// Schedule is a minimum interval between checks, expressed as a
+	// Go duration (e.g. "24h", "12h"). Feeds without a schedule are
+	// checked on every run.
+	Schedule string `yaml:"schedule,omitempty"`
+}
+
+// Config is the top-level shape of a snarf config file listing many
+// feeds to keep mirrored.
+type Config struct {
+	Feeds []FeedConfig `yaml:"feeds"`
+}
+
+// loadConfig reads a YAML multi-feed config file from path.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// opmlDocument mirrors the subset of the OPML 2.0 schema used by
+// podcast subscription exports: a tree of <outline> elements, the
+// feed ones carrying an xmlUrl attribute.
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Body    struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// loadOPML reads an OPML subscription export and returns one
+// FeedConfig per outline that carries a feed URL, descending into
+// nested outlines (OPML readers commonly group feeds into folders).
+func loadOPML(path string) ([]FeedConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc opmlDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var feeds []FeedConfig
+	var walk func([]opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, outline := range outlines {
+			if outline.XMLURL != "" {
+				name := outline.Title
+				if name == "" {
+					name = outline.Text
+				}
+				feeds = append(feeds, FeedConfig{
+					URL:         outline.XMLURL,
+					Destination: snakeCase(name),
+				})
+			}
+			walk(outline.Outlines)
+		}
+	}
+	walk(doc.Body.Outlines)
+
+	return feeds, nil
+}
+
+// loadFeedConfigs assembles the full list of feeds to process for
+// this run from whichever sources were given: a multi-feed config
+// file, an OPML import, and/or a single -f feed with its CLI filter
+// flags.
+func loadFeedConfigs(feed, configPath, opmlPath, tag, notag string, limit int) ([]FeedConfig, error) {
+	var feeds []FeedConfig
+
+	if configPath != "" {
+		config, err := loadConfig(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config %s: %w", configPath, err)
+		}
+		feeds = append(feeds, config.Feeds...)
+	}
+
+	if opmlPath != "" {
+		imported, err := loadOPML(opmlPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load opml %s: %w", opmlPath, err)
+		}
+		feeds = append(feeds, imported...)
+	}
+
+	if feed != "" {
+		feeds = append(feeds, FeedConfig{
+			URL:    feed,
+			Tags:   splitTagFlag(tag),
+			NoTags: splitTagFlag(notag),
+			Limit:  limit,
+		})
+	}
+
+	return feeds, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileMeta records the HTTP validators returned for a previously
+// completed download so subsequent runs can ask the server "has this
+// changed?" instead of re-downloading blindly.
+type fileMeta struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// metaPathFor returns the sidecar path used to store a file's cache
+// validators, e.g. "feeds/<hash>" -> "feeds/<hash>.meta.json".
+func metaPathFor(filePath string) string {
+	return filePath + ".meta.json"
+}
+
+// partPathFor returns the in-progress download path for filePath. It
+// is only renamed to filePath once the transfer completes in full.
+func partPathFor(filePath string) string {
+	return filePath + ".part"
+}
+
+func loadFileMeta(filePath string) (*fileMeta, error) {
+	data, err := os.ReadFile(metaPathFor(filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var meta fileMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+
+	return &meta, nil
+}
+
+func saveFileMeta(filePath string, meta *fileMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(metaPathFor(filePath), data, 0644)
+}
+
+// hasValidators reports whether a previous download recorded any
+// conditional-request validators for filePath.
+func hasValidators(filePath string) bool {
+	meta, err := loadFileMeta(filePath)
+	return err == nil && meta != nil && (meta.ETag != "" || meta.LastModified != "")
+}
+
+// downloadError wraps the HTTP status, URL, and number of bytes
+// written for a failed download, so callers can log or retry with
+// more context than a bare string error.
+type downloadError struct {
+	URL        string
+	StatusCode int
+	Bytes      int64
+}
+
+func (e *downloadError) Error() string {
+	return fmt.Sprintf("could not fetch %s (status %d, %d bytes received)", e.URL, e.StatusCode, e.Bytes)
+}
+
+// downloadFile fetches the contents at url and writes them to
+// filepath. It streams into a ".part" sidecar and only renames to the
+// final path once the transfer completes successfully.
+//
+// If a ".part" file already exists from a previous interrupted run, it
+// resumes with a Range request rather than restarting from zero. If
+// filepath already exists in full and carries cache validators from an
+// earlier download, a conditional request is sent first so an
+// unchanged remote resource costs a round trip instead of a
+// re-download.
+//
+// guid identifies the item being downloaded for per-item progress
+// reporting; pass "" for downloads (e.g. feed files) that aren't tied
+// to a single item.
+func downloadFile(url string, filepath string, guid string) error {
+	partPath := partPathFor(filepath)
+
+	partInfo, err := os.Stat(partPath)
+	resuming := err == nil
+
+	if !resuming && checkNotModified(url, filepath) {
+		now := time.Now()
+		return os.Chtimes(filepath, now, now)
+	}
+
+	downloadProgress.start(guid)
+	defer downloadProgress.done(guid)
+
+	var offset int64
+	if resuming {
+		offset = partInfo.Size()
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if partMeta, err := loadFileMeta(partPath); err == nil {
+			if partMeta.ETag != "" {
+				req.Header.Set("If-Range", partMeta.ETag)
+			} else if partMeta.LastModified != "" {
+				req.Header.Set("If-Range", partMeta.LastModified)
+			}
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &downloadError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	// The server may ignore our Range request (some don't support it,
+	// or the resource changed and If-Range failed) and send the whole
+	// body back instead; in that case start over from zero.
+	appending := resp.StatusCode == http.StatusPartialContent
+	flags := os.O_CREATE | os.O_WRONLY
+	if appending {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+		offset = 0
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	if expected, ok := expectedTotalSize(resp, appending); ok {
+		downloadProgress.setTotal(guid, expected)
+	}
+
+	body := &countingReader{Reader: resp.Body, guid: guid, progress: downloadProgress}
+	written, copyErr := io.Copy(out, body)
+	out.Close()
+
+	total := offset + written
+	if copyErr != nil {
+		saveDownloadMeta(partPath, resp)
+		return &downloadError{URL: url, StatusCode: resp.StatusCode, Bytes: total}
+	}
+
+	if expected, ok := expectedTotalSize(resp, appending); ok && expected != total {
+		// Truncated transfer; keep the .part file so the next run
+		// can resume instead of starting from scratch.
+		saveDownloadMeta(partPath, resp)
+		return &downloadError{URL: url, StatusCode: resp.StatusCode, Bytes: total}
+	}
+
+	if err := os.Rename(partPath, filepath); err != nil {
+		return err
+	}
+	os.Remove(metaPathFor(partPath))
+
+	return saveDownloadMeta(filepath, resp)
+}
+
+// checkNotModified sends a conditional request for url using the
+// validators stored for filepath, if any, and reports whether the
+// server returned 304 Not Modified. When filepath has no cache
+// validators it returns false without making a request, leaving the
+// caller to fall back to its own staleness heuristic. A transport-level
+// failure (timeout, connection reset, DNS hiccup) is treated the same
+// way: this is just a cheap pre-check, so any error here falls back to
+// the normal GET rather than aborting the whole download.
+func checkNotModified(url string, filepath string) bool {
+	if !fileExists(filepath) || !hasValidators(filepath) {
+		return false
+	}
+
+	meta, err := loadFileMeta(filepath)
+	if err != nil {
+		return false
+	}
+
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return false
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == http.StatusNotModified
+}
+
+// expectedTotalSize derives the full expected file size from a
+// download response, if the server told us. For a 206 it reads the
+// total from the Content-Range header; otherwise it falls back to
+// Content-Length.
+func expectedTotalSize(resp *http.Response, appending bool) (int64, bool) {
+	if appending {
+		if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+			if idx := strings.LastIndex(contentRange, "/"); idx != -1 {
+				if total, err := strconv.ParseInt(contentRange[idx+1:], 10, 64); err == nil {
+					return total, true
+				}
+			}
+		}
+		return 0, false
+	}
+
+	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
+		if length, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
+			return length, true
+		}
+	}
+
+	return 0, false
+}
+
+// saveDownloadMeta stores the ETag/Last-Modified validators from a
+// response against filepath, if the server provided any. When neither
+// is present we remove any stale meta file so callers fall back to
+// the mtime-based heuristic instead of sending conditional headers
+// that will never be honored.
+func saveDownloadMeta(filepath string, resp *http.Response) error {
+	meta := &fileMeta{
+		ETag:      resp.Header.Get("ETag"),
+		FetchedAt: time.Now(),
+	}
+
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		if _, err := http.ParseTime(lastModified); err == nil {
+			meta.LastModified = lastModified
+		}
+	}
+
+	if meta.ETag == "" && meta.LastModified == "" {
+		os.Remove(metaPathFor(filepath))
+		return nil
+	}
+
+	return saveFileMeta(filepath, meta)
+}
+
+// verifyDownloadSize compares a downloaded file's size against a
+// length the caller already knows to expect (e.g. an RSS enclosure's
+// declared length), returning an error on mismatch. It is a best
+// effort check: callers decide whether to treat a mismatch as fatal.
+func verifyDownloadSize(filepath string, expectedLength int64) error {
+	if expectedLength <= 0 {
+		return nil
+	}
+
+	info, err := os.Stat(filepath)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != expectedLength {
+		return fmt.Errorf("%s: expected %d bytes, got %d", filepath, expectedLength, info.Size())
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// mimeExtensions maps common podcast/media MIME types to their
+// canonical file extension. The stdlib mime package's extension
+// lookup is geared toward web content types and is inconsistent
+// across platforms for audio/video, so we keep an explicit table for
+// the formats snarf actually encounters.
+var mimeExtensions = map[string]string{
+	"audio/mpeg":      ".mp3",
+	"audio/mp3":       ".mp3",
+	"audio/mp4":       ".m4a",
+	"audio/x-m4a":     ".m4a",
+	"audio/aac":       ".aac",
+	"audio/ogg":       ".ogg",
+	"audio/opus":      ".opus",
+	"audio/flac":      ".flac",
+	"audio/wav":       ".wav",
+	"audio/x-wav":     ".wav",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/quicktime": ".mov",
+	"application/pdf": ".pdf",
+}
+
+const defaultExtension = ".bin"
+
+// fileExtensionForEnclosure determines the file extension to use for
+// an enclosure. It prefers the declared MIME type over the download
+// URL, since URLs with query-string-based file identifiers
+// (?file=ep1) or multiple dots in the path (ep.1.final.mp3) defeat
+// naive path-based parsing. As a last resort it issues a HEAD request
+// and reads the response's Content-Type.
+func fileExtensionForEnclosure(enclosure *gofeed.Enclosure) string {
+	if ext, ok := mimeExtensions[normalizeMimeType(enclosure.Type)]; ok {
+		return ext
+	}
+
+	if ext := fileExtensionFromPath(enclosure.URL); ext != "" {
+		return ext
+	}
+
+	if ext, ok := mimeExtensions[normalizeMimeType(fetchContentType(enclosure.URL))]; ok {
+		return ext
+	}
+
+	return defaultExtension
+}
+
+func normalizeMimeType(mimeType string) string {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if idx := strings.Index(mimeType, ";"); idx != -1 {
+		mimeType = mimeType[:idx]
+	}
+
+	return mimeType
+}
+
+// fileExtensionFromPath extracts a file extension from a URL's path
+// component, ignoring any query string, so only the final dot-suffix
+// of the actual file name is considered.
+func fileExtensionFromPath(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Ext(u.Path)
+}
+
+// headClient is used for the best-effort Content-Type lookup in
+// fetchContentType. A short timeout keeps this last-resort fallback
+// from hanging on a host that accepts the connection but never
+// responds.
+var headClient = &http.Client{Timeout: 5 * time.Second}
+
+// fetchContentType issues a HEAD request as a last resort when
+// neither the enclosure's declared type nor its URL reveal a usable
+// extension.
+func fetchContentType(href string) string {
+	req, err := http.NewRequest("HEAD", href, nil)
+	if err != nil {
+		return ""
+	}
+
+	resp, err := headClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	return resp.Header.Get("Content-Type")
+}
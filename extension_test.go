@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestFileExtensionForEnclosure(t *testing.T) {
+	tests := []struct {
+		name      string
+		enclosure *gofeed.Enclosure
+		want      string
+	}{
+		{
+			name:      "known MIME type",
+			enclosure: &gofeed.Enclosure{Type: "audio/mpeg", URL: "https://cdn.example/track.mp3"},
+			want:      ".mp3",
+		},
+		{
+			name:      "MIME type with parameters",
+			enclosure: &gofeed.Enclosure{Type: "audio/mpeg; charset=utf-8", URL: "https://cdn.example/track"},
+			want:      ".mp3",
+		},
+		{
+			name:      "falls back to URL path when type is unrecognized",
+			enclosure: &gofeed.Enclosure{Type: "", URL: "https://cdn.example/episodes/ep.1.final.mp3"},
+			want:      ".mp3",
+		},
+		{
+			name:      "query string is ignored when resolving from the path",
+			enclosure: &gofeed.Enclosure{Type: "", URL: "https://cdn.example/track.m4a?token=abc"},
+			want:      ".m4a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileExtensionForEnclosure(tt.enclosure); got != tt.want {
+				t.Errorf("fileExtensionForEnclosure(%+v) = %q, want %q", tt.enclosure, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFileExtensionForEnclosureHeadFallback covers the last-resort HEAD
+// request path. It uses an httptest.Server rather than a real host so
+// the test exercises no real network I/O and can't hang.
+func TestFileExtensionForEnclosureHeadFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		want        string
+	}{
+		{name: "HEAD response has a recognized content type", contentType: "audio/mpeg", want: ".mp3"},
+		{name: "HEAD response has no usable content type", contentType: "", want: defaultExtension},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+			}))
+			defer server.Close()
+
+			enclosure := &gofeed.Enclosure{Type: "", URL: server.URL + "/track?file=ep1"}
+			if got := fileExtensionForEnclosure(enclosure); got != tt.want {
+				t.Errorf("fileExtensionForEnclosure(%+v) = %q, want %q", enclosure, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileExtensionFromPath(t *testing.T) {
+	tests := []struct {
+		name string
+		href string
+		want string
+	}{
+		{name: "simple path", href: "https://cdn.example/track.mp3", want: ".mp3"},
+		{name: "multiple dots keeps the last suffix", href: "https://cdn.example/ep.1.final.mp3", want: ".mp3"},
+		{name: "query string is ignored", href: "https://cdn.example/track.mp3?token=abc", want: ".mp3"},
+		{name: "no extension", href: "https://cdn.example/track?file=ep1", want: ""},
+		{name: "invalid URL", href: "://not a url", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileExtensionFromPath(tt.href); got != tt.want {
+				t.Errorf("fileExtensionFromPath(%q) = %q, want %q", tt.href, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMimeType(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "lowercased", in: "AUDIO/MPEG", want: "audio/mpeg"},
+		{name: "trims parameters", in: "audio/mpeg; charset=utf-8", want: "audio/mpeg"},
+		{name: "trims whitespace", in: "  audio/mpeg  ", want: "audio/mpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeMimeType(tt.in); got != tt.want {
+				t.Errorf("normalizeMimeType(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// filterOptions narrows the set of feed items snarf will enqueue,
+// driven by the -tag, -notag, -since, and -limit flags.
+type filterOptions struct {
+	tags   []string
+	notags []string
+	since  time.Time
+	limit  int
+}
+
+// filterItems applies opts to items, which is assumed to be in feed
+// order (newest first). A non-zero limit keeps only the N most recent
+// items that otherwise pass the tag/since filters.
+func filterItems(items []*gofeed.Item, opts filterOptions) []*gofeed.Item {
+	filtered := make([]*gofeed.Item, 0, len(items))
+
+	for _, item := range items {
+		if len(opts.tags) > 0 && !itemHasAnyCategory(item, opts.tags) {
+			continue
+		}
+		if len(opts.notags) > 0 && itemHasAnyCategory(item, opts.notags) {
+			continue
+		}
+		if !opts.since.IsZero() && item.PublishedParsed != nil && item.PublishedParsed.Before(opts.since) {
+			continue
+		}
+
+		filtered = append(filtered, item)
+	}
+
+	if opts.limit > 0 && len(filtered) > opts.limit {
+		filtered = filtered[:opts.limit]
+	}
+
+	return filtered
+}
+
+func itemHasAnyCategory(item *gofeed.Item, tags []string) bool {
+	for _, category := range item.Categories {
+		for _, tag := range tags {
+			if strings.EqualFold(category, tag) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// splitTagFlag splits a comma-separated -tag/-notag flag value into
+// trimmed, non-empty tags.
+func splitTagFlag(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// itemGUID returns a stable identifier for item, falling back to the
+// first enclosure's URL or the item's title when the feed does not
+// supply a GUID.
+func itemGUID(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	if len(item.Enclosures) > 0 && item.Enclosures[0].URL != "" {
+		return item.Enclosures[0].URL
+	}
+
+	return item.Title
+}
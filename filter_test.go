@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func item(title string, categories []string, published string) *gofeed.Item {
+	it := &gofeed.Item{Title: title, Categories: categories}
+	if published != "" {
+		t, err := time.Parse("2006-01-02", published)
+		if err != nil {
+			panic(err)
+		}
+		it.PublishedParsed = &t
+	}
+
+	return it
+}
+
+func TestFilterItems(t *testing.T) {
+	items := []*gofeed.Item{
+		item("newest", []string{"News"}, "2024-03-03"),
+		item("middle", []string{"Sports", "News"}, "2024-02-02"),
+		item("oldest", []string{"Sports"}, "2024-01-01"),
+	}
+
+	tests := []struct {
+		name  string
+		opts  filterOptions
+		items []*gofeed.Item
+		want  []string
+	}{
+		{
+			name:  "no filters keeps everything in order",
+			opts:  filterOptions{},
+			items: items,
+			want:  []string{"newest", "middle", "oldest"},
+		},
+		{
+			name:  "tag keeps items matching any of the given categories",
+			opts:  filterOptions{tags: []string{"news"}},
+			items: items,
+			want:  []string{"newest", "middle"},
+		},
+		{
+			name:  "notag drops items matching any of the given categories",
+			opts:  filterOptions{notags: []string{"sports"}},
+			items: items,
+			want:  []string{"newest"},
+		},
+		{
+			name:  "since drops items published before the cutoff",
+			opts:  filterOptions{since: mustParseDate(t, "2024-02-02")},
+			items: items,
+			want:  []string{"newest", "middle"},
+		},
+		{
+			name:  "limit keeps only the N most recent items",
+			opts:  filterOptions{limit: 2},
+			items: items,
+			want:  []string{"newest", "middle"},
+		},
+		{
+			name:  "tag and notag combine",
+			opts:  filterOptions{tags: []string{"News", "Sports"}, notags: []string{"Sports"}},
+			items: items,
+			want:  []string{"newest"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterItems(tt.items, tt.opts)
+			if len(got) != len(tt.want) {
+				t.Fatalf("filterItems() = %v, want %v", titles(got), tt.want)
+			}
+			for i, it := range got {
+				if it.Title != tt.want[i] {
+					t.Errorf("filterItems()[%d] = %q, want %q", i, it.Title, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func titles(items []*gofeed.Item) []string {
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i] = it.Title
+	}
+	return out
+}
+
+func mustParseDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestSplitTagFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "empty string", value: "", want: nil},
+		{name: "single tag", value: "news", want: []string{"news"}},
+		{name: "multiple tags", value: "news,sports", want: []string{"news", "sports"}},
+		{name: "trims whitespace", value: " news , sports ", want: []string{"news", "sports"}},
+		{name: "skips empty entries", value: "news,,sports", want: []string{"news", "sports"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitTagFlag(tt.value)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitTagFlag(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("splitTagFlag(%q)[%d] = %q, want %q", tt.value, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
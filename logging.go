@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logger is the process-wide structured logger, configured in main
+// from the -v/--log-level and -q flags before any other package code
+// runs.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// newLogger builds a logger at the level named by levelName (debug,
+// info, warn, error; defaults to info). quiet forces warn-and-above
+// regardless of levelName, for -q.
+func newLogger(levelName string, quiet bool) *slog.Logger {
+	level := parseLogLevel(levelName)
+	if quiet {
+		level = slog.LevelWarn
+	}
+
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+
+	return slog.New(handler)
+}
+
+func parseLogLevel(name string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
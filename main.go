@@ -2,15 +2,12 @@ package main
 
 import (
 	"crypto/md5"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"os/user"
-	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,46 +18,58 @@ import (
 func main() {
 	var feed string
 	var destination string
+	var configPath string
+	var opmlPath string
+	var tag string
+	var notag string
+	var since string
+	var limit int
+	var logLevel string
+	var quiet bool
 	start := time.Now()
 
-	flag.StringVar(&feed, "f", "", "The rss feed to inspect")
+	flag.StringVar(&feed, "f", "", "A single rss feed to inspect")
 	flag.StringVar(&destination, "d", "", "The destination directory")
+	flag.StringVar(&configPath, "config", "", "A YAML config file listing multiple feeds")
+	flag.StringVar(&opmlPath, "opml", "", "An OPML file to bulk-import feeds from")
+	flag.StringVar(&tag, "tag", "", "Only fetch items tagged with one of these comma-separated categories")
+	flag.StringVar(&notag, "notag", "", "Skip items tagged with one of these comma-separated categories")
+	flag.StringVar(&since, "since", "", "Only fetch items published on or after this date (YYYY-MM-DD)")
+	flag.IntVar(&limit, "limit", 0, "Only fetch the N most recent items (0 for no limit)")
+	flag.StringVar(&logLevel, "log-level", "info", "Log level: debug, info, warn, or error")
+	flag.StringVar(&logLevel, "v", "info", "Shorthand for -log-level")
+	flag.BoolVar(&quiet, "q", false, "Only log warnings and errors")
 	flag.Parse()
 
-	if len(feed) == 0 {
-		fmt.Println("No feed provided.")
-		return
-	}
+	logger = newLogger(logLevel, quiet)
 
 	if len(destination) == 0 {
 		destination = getUserConfigDirectory()
 	}
 
-	// Make sure the destination directory exists
-	_, err := os.Stat(destination)
-	if os.IsNotExist(err) {
-		os.MkdirAll(destination, 0755)
+	var sinceTime time.Time
+	if len(since) > 0 {
+		var err error
+		sinceTime, err = time.Parse("2006-01-02", since)
+		if err != nil {
+			logger.Error("invalid -since date, expected YYYY-MM-DD", "error", err)
+			return
+		}
 	}
 
-	// Read the contents of the file
-	contents, err := readFeed(feed, destination)
+	feeds, err := loadFeedConfigs(feed, configPath, opmlPath, tag, notag, limit)
 	if err != nil {
-		panic(err)
+		logger.Error("failed to load feeds", "error", err)
+		return
+	}
+	if len(feeds) == 0 {
+		logger.Warn("no feed provided")
+		return
 	}
 
-	fmt.Println("Checking feed contents...")
-
-	feedName := snakeCase(contents.Title)
-
-	// Add jobs to the queue
-	var jobs []Job
-	for i := len(contents.Items) - 1; i >= 0; i-- {
-		job := Job{
-			ID:          i,
-			Item:        contents.Items[i],
-			Destination: destination + "/" + feedName,
-		}
-		jobs = append(jobs, job)
+	// Make sure the destination directory exists
+	if _, err := os.Stat(destination); os.IsNotExist(err) {
+		os.MkdirAll(destination, 0755)
 	}
 
 	const NumberOfWorkers = 5
@@ -70,19 +79,76 @@ func main() {
 	)
 	wg.Add(NumberOfWorkers)
 
-	// start the workers
+	stopProgress := make(chan struct{})
+	go downloadProgress.reportEvery(5*time.Second, stopProgress)
+
+	// start the workers; this single pool is shared across every feed
+	// below, so NumberOfWorkers bounds overall concurrency rather than
+	// concurrency per feed.
 	for i := 0; i < NumberOfWorkers; i++ {
 		go worker(i, &wg, jobChannel)
 	}
 
-	// Send jobs to workers
-	for _, job := range jobs {
-		jobChannel <- job
+	for _, fc := range feeds {
+		enqueueFeed(fc, destination, sinceTime, jobChannel)
 	}
 	close(jobChannel)
 	wg.Wait()
+	close(stopProgress)
 
-	fmt.Printf("Took %s\n", time.Since(start))
+	logger.Info("run complete", "duration_ms", time.Since(start).Milliseconds())
+}
+
+// enqueueFeed reads a single feed, applies its filters, and sends one
+// Job per matching item onto jobChannel. Sending blocks until a
+// worker is free, so feeds are enqueued one at a time but downloaded
+// by the shared worker pool.
+func enqueueFeed(fc FeedConfig, baseDestination string, since time.Time, jobChannel chan<- Job) {
+	destination := baseDestination
+	if fc.Destination != "" {
+		destination = baseDestination + "/" + fc.Destination
+	}
+
+	feedFilePath := destination + "/feeds/" + generateFeedHash(fc.URL)
+	state := loadStateStore(statePathFor(feedFilePath))
+
+	if fc.Schedule != "" {
+		interval, err := time.ParseDuration(fc.Schedule)
+		if err != nil {
+			logger.Warn("invalid schedule", "feed", fc.URL, "schedule", fc.Schedule, "error", err)
+		} else if !state.dueSince(interval) {
+			logger.Info("skipping feed, not due yet", "feed", fc.URL)
+			return
+		}
+	}
+
+	contents, err := readFeed(fc.URL, destination)
+	if err != nil {
+		logger.Error("failed to read feed", "feed", fc.URL, "error", err)
+		return
+	}
+
+	logger.Info("checking feed contents", "feed", fc.URL)
+
+	feedName := snakeCase(contents.Title)
+	opts := filterOptions{
+		tags:   fc.Tags,
+		notags: fc.NoTags,
+		limit:  fc.Limit,
+		since:  since,
+	}
+	items := filterItems(contents.Items, opts)
+
+	for i := len(items) - 1; i >= 0; i-- {
+		jobChannel <- Job{
+			ID:          i,
+			Item:        items[i],
+			Destination: destination + "/" + feedName,
+			State:       state,
+		}
+	}
+
+	state.touch()
 }
 
 func generateFeedHash(feed string) string {
@@ -105,17 +171,21 @@ func readFeed(feed string, destination string) (*gofeed.Feed, error) {
 	}
 
 	fileInfo, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		fmt.Println("Downloading feed contents: ", filePath)
-		downloadFile(feed, filePath)
-	}
-
-	// Is the locally cached file older than seven days?
-	currentTime := time.Now()
-	diff := currentTime.Sub(fileInfo.ModTime())
-	if diff.Minutes() > (60 * 24 * 7) {
-		fmt.Println("Refreshing feed contents: ", filePath)
-		downloadFile(feed, filePath)
+	switch {
+	case os.IsNotExist(err):
+		logger.Debug("downloading feed contents", "feed", feed, "path", filePath)
+		downloadFile(feed, filePath, "")
+	case hasValidators(filePath):
+		// We have an ETag/Last-Modified from a previous fetch, so
+		// downloadFile can send a conditional request; it's cheap
+		// even when nothing has changed.
+		logger.Debug("checking feed contents for changes", "feed", feed, "path", filePath)
+		downloadFile(feed, filePath, "")
+	case time.Since(fileInfo.ModTime()).Minutes() > (60 * 24 * 7):
+		// No validators to condition on; fall back to the old
+		// "refresh after 7 days" heuristic.
+		logger.Debug("refreshing feed contents", "feed", feed, "path", filePath)
+		downloadFile(feed, filePath, "")
 	}
 
 	file, err := os.Open(filePath)
@@ -128,37 +198,6 @@ func readFeed(feed string, destination string) (*gofeed.Feed, error) {
 	return fp.Parse(file)
 }
 
-// https://progolang.com/how-to-download-files-in-go/
-func downloadFile(url string, filepath string) error {
-	// create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// How can we determine if a download has not completed?
-
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return errors.New("Could not reach " + url)
-	}
-
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // Get the user's "config" directory
 func getUserConfigDirectory() string {
 	usr, err := user.Current()
@@ -175,7 +214,7 @@ func worker(id int, wg *sync.WaitGroup, jobChannel <-chan Job) {
 	for job := range jobChannel {
 		result := maybeDownloadItem(id, job)
 		if result.Important {
-			fmt.Printf("%s\n", result.Message)
+			logger.Info(result.Message, "worker", id, "item_guid", itemGUID(job.Item))
 		}
 		if result.Downloaded {
 			time.Sleep(5 * time.Second)
@@ -183,8 +222,8 @@ func worker(id int, wg *sync.WaitGroup, jobChannel <-chan Job) {
 	}
 }
 
-// Download the contents of an Item enclosure if it does not already
-// exist in the destination folder.
+// Download the contents of an Item enclosure if it is not already
+// recorded as downloaded in the feed's state.
 func maybeDownloadItem(id int, job Job) JobResult {
 
 	// If no enclosures are listed we will skip this item
@@ -196,19 +235,20 @@ func maybeDownloadItem(id int, job Job) JobResult {
 		}
 	}
 
-	enclosure := job.Item.Enclosures[0]
-
-	// Extract the file extension from the download URL
-	extension, err := fileExtensionFromURL(enclosure.URL)
-
-	if err != nil {
+	guid := itemGUID(job.Item)
+	if job.State.has(guid) {
 		return JobResult{
-			Message:    "No file to download",
+			Message:    "Already downloaded " + job.Item.Title,
 			Important:  false,
 			Downloaded: false,
 		}
 	}
 
+	enclosure := job.Item.Enclosures[0]
+
+	// Resolve the file extension from the enclosure's declared type
+	extension := fileExtensionForEnclosure(enclosure)
+
 	// Make sure our destination folder exists
 	if !fileExists(job.Destination) {
 		os.MkdirAll(job.Destination, 0755)
@@ -218,22 +258,73 @@ func maybeDownloadItem(id int, job Job) JobResult {
 	fileName := snakeCase(job.Item.Title)
 	path := job.Destination + "/" + fileName + extension
 
+	// state.json may not know about a file that already exists on disk,
+	// e.g. after upgrading from a version that predates it, restoring
+	// from backup, or moving files around by hand. Back-fill a state
+	// entry instead of blindly re-downloading and overwriting it.
 	if fileExists(path) {
+		itemState := ItemState{
+			GUID:         guid,
+			Title:        job.Item.Title,
+			FilePath:     path,
+			DownloadedAt: time.Now(),
+		}
+		if job.Item.PublishedParsed != nil {
+			itemState.PublishedAt = *job.Item.PublishedParsed
+		}
+		if info, err := os.Stat(path); err == nil {
+			itemState.Size = info.Size()
+		}
+		if err := job.State.record(itemState); err != nil {
+			logger.Warn("failed to record item state", "item_guid", guid, "error", err)
+		}
 		return JobResult{
-			Message:    "Already Downloaded " + path,
+			Message:    "Already downloaded " + job.Item.Title,
 			Important:  false,
 			Downloaded: false,
 		}
 	}
 
-	err = downloadFile(enclosure.URL, path)
+	downloadStart := time.Now()
+	err := downloadFile(enclosure.URL, path, guid)
+	duration := time.Since(downloadStart)
 	if err != nil {
+		logger.Error("download failed", "item_guid", guid, "url", enclosure.URL, "duration_ms", duration.Milliseconds(), "error", err)
 		return JobResult{
 			Message:    err.Error(),
 			Important:  true,
 			Downloaded: false,
 		}
 	}
+	logger.Debug("download complete", "item_guid", guid, "url", enclosure.URL, "duration_ms", duration.Milliseconds())
+
+	// The RSS item may declare the enclosure's expected size; use it
+	// as a best-effort sanity check against what we actually wrote.
+	if expectedLength, err := strconv.ParseInt(enclosure.Length, 10, 64); err == nil {
+		if err := verifyDownloadSize(path, expectedLength); err != nil {
+			return JobResult{
+				Message:    err.Error(),
+				Important:  true,
+				Downloaded: true,
+			}
+		}
+	}
+
+	itemState := ItemState{
+		GUID:         guid,
+		Title:        job.Item.Title,
+		FilePath:     path,
+		DownloadedAt: time.Now(),
+	}
+	if job.Item.PublishedParsed != nil {
+		itemState.PublishedAt = *job.Item.PublishedParsed
+	}
+	if info, err := os.Stat(path); err == nil {
+		itemState.Size = info.Size()
+	}
+	if err := job.State.record(itemState); err != nil {
+		logger.Warn("failed to record item state", "item_guid", guid, "error", err)
+	}
 
 	return JobResult{
 		Message:    fmt.Sprintf("downloaded: %s", job.Item.Title),
@@ -242,25 +333,6 @@ func maybeDownloadItem(id int, job Job) JobResult {
 	}
 }
 
-func fileExtensionFromURL(href string) (string, error) {
-	// Parse the URL
-	u, err := url.Parse(href)
-	if err != nil {
-		return "", err
-	}
-	// Remove the query parameters
-	u.RawQuery = ""
-
-	// Extract the file name from the URL
-	filename := path.Base(u.String())
-
-	// Find the location of the "."
-	pivot := strings.Index(filename, ".")
-
-	// Return the file extension as a string
-	return filename[pivot:], nil
-}
-
 func snakeCase(name string) string {
 	name = strings.ToLower(name)
 	name = strings.Replace(name, " ", "_", -1)
@@ -278,6 +350,7 @@ type Job struct {
 	ID          int
 	Item        *gofeed.Item
 	Destination string
+	State       *stateStore
 }
 
 type JobResult struct {
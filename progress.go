@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// itemProgress tracks how far a single in-flight download has gotten.
+// total is 0 when the server hasn't told us the expected size yet.
+type itemProgress struct {
+	bytes int64
+	total int64
+}
+
+// progressTracker tracks per-item download progress, keyed by item
+// GUID, so the worker pool can report each transfer's own completion
+// instead of one undifferentiated total across every concurrent
+// download.
+type progressTracker struct {
+	mu    sync.Mutex
+	items map[string]*itemProgress
+}
+
+// downloadProgress is the shared tracker all item downloads in this
+// process report to.
+var downloadProgress = &progressTracker{items: map[string]*itemProgress{}}
+
+// start begins tracking guid, with total set to the expected size if
+// known (0 otherwise). Callers with no GUID to track against (e.g. a
+// feed file rather than an item) should pass an empty guid, which
+// start, add, setTotal, and done all silently ignore.
+func (p *progressTracker) start(guid string) {
+	if guid == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.items[guid] = &itemProgress{}
+}
+
+// setTotal records the expected total size for guid once it becomes
+// known, e.g. after the response headers for a download arrive.
+func (p *progressTracker) setTotal(guid string, total int64) {
+	if guid == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ip, ok := p.items[guid]; ok {
+		ip.total = total
+	}
+}
+
+func (p *progressTracker) add(guid string, n int64) {
+	if guid == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ip, ok := p.items[guid]; ok {
+		ip.bytes += n
+	}
+}
+
+// done stops tracking guid, e.g. once its download has finished or
+// failed.
+func (p *progressTracker) done(guid string) {
+	if guid == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.items, guid)
+}
+
+func (p *progressTracker) snapshot() map[string]itemProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make(map[string]itemProgress, len(p.items))
+	for guid, ip := range p.items {
+		out[guid] = *ip
+	}
+
+	return out
+}
+
+// reportEvery logs each in-flight item's download progress every
+// interval until stop is closed.
+func (p *progressTracker) reportEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for guid, ip := range p.snapshot() {
+				if ip.total > 0 {
+					logger.Debug("progress", "item_guid", guid, "bytes_downloaded", ip.bytes, "bytes_total", ip.total, "percent", int(ip.bytes*100/ip.total))
+				} else {
+					logger.Debug("progress", "item_guid", guid, "bytes_downloaded", ip.bytes)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// countingReader wraps an io.Reader, reporting every read against guid
+// so callers can observe that item's transfer progress mid-download.
+type countingReader struct {
+	io.Reader
+	guid     string
+	progress *progressTracker
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if n > 0 && c.progress != nil {
+		c.progress.add(c.guid, int64(n))
+	}
+
+	return n, err
+}
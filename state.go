@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// ItemState records what we know about a single feed item we have
+// already downloaded, so later runs can skip it without relying on a
+// filesystem existence check (which breaks if a title changes or the
+// file gets moved).
+type ItemState struct {
+	GUID         string    `json:"guid"`
+	Title        string    `json:"title"`
+	FilePath     string    `json:"file_path"`
+	Size         int64     `json:"size"`
+	PublishedAt  time.Time `json:"published_at,omitempty"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// FeedState is the persisted record of everything snarf has
+// downloaded for a single feed, keyed by item GUID.
+type FeedState struct {
+	Items     map[string]ItemState `json:"items"`
+	LastRunAt time.Time            `json:"last_run_at,omitempty"`
+}
+
+// stateStore guards a FeedState with a mutex so concurrent workers
+// can safely record downloads and flushes it to disk after each
+// change.
+type stateStore struct {
+	mu    sync.Mutex
+	path  string
+	state FeedState
+}
+
+// statePathFor returns the path used to persist a feed's download
+// state, e.g. "feeds/<hash>" -> "feeds/<hash>.state.json".
+func statePathFor(feedFilePath string) string {
+	return feedFilePath + ".state.json"
+}
+
+// loadStateStore reads a feed's persisted state from path, if it
+// exists, returning an empty store otherwise.
+func loadStateStore(path string) *stateStore {
+	store := &stateStore{path: path, state: FeedState{Items: map[string]ItemState{}}}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return store
+	}
+
+	if err := json.Unmarshal(data, &store.state); err != nil {
+		logger.Warn("failed to parse state file, starting fresh", "path", path, "error", err)
+		store.state = FeedState{Items: map[string]ItemState{}}
+		return store
+	}
+	if store.state.Items == nil {
+		store.state.Items = map[string]ItemState{}
+	}
+
+	return store
+}
+
+// has reports whether guid has already been recorded as downloaded.
+func (s *stateStore) has(guid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.state.Items[guid]
+	return ok
+}
+
+// record stores item's state and persists the store to disk.
+func (s *stateStore) record(item ItemState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Items[item.GUID] = item
+
+	return s.saveLocked()
+}
+
+// dueSince reports whether at least interval has passed since this
+// feed was last run, so a configured schedule can be honored.
+func (s *stateStore) dueSince(interval time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.LastRunAt.IsZero() || time.Since(s.state.LastRunAt) >= interval
+}
+
+// touch records that this feed was just checked and persists the
+// store to disk.
+func (s *stateStore) touch() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.LastRunAt = time.Now()
+
+	return s.saveLocked()
+}
+
+// saveLocked writes the state to a temp file and renames it into
+// place, so a crash or power loss mid-write can never truncate or
+// corrupt the existing state.json - the same pattern downloadFile uses
+// for downloads themselves.
+func (s *stateStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}